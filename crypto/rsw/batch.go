@@ -0,0 +1,132 @@
+package rsw
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/mit-dci/opencx/crypto"
+)
+
+// SetupBatch sets up len(keys) timelock puzzles that all share one
+// (n, a, t) triple, and therefore one b = a^(2^t) (mod n), instead of
+// recomputing b once per key the way repeated calls to
+// SetupTimelockPuzzle would. This is the natural shape for a sealed-bid
+// auction round: every bid timelocks under the same auctioneer modulus,
+// just with a different key.
+func (tl *TimelockRSW) SetupBatch(keys [][]byte, t uint64) (puzzles []crypto.Puzzle, err error) {
+	tl.t = new(big.Int).SetUint64(t)
+	var n *big.Int
+	if n, err = tl.n(); err != nil {
+		err = fmt.Errorf("Could not find n: %s", err)
+		return
+	}
+	var b *big.Int
+	if b, err = tl.b(); err != nil {
+		err = fmt.Errorf("Could not find b: %s", err)
+		return
+	}
+
+	puzzles = make([]crypto.Puzzle, len(keys))
+	for i, key := range keys {
+		k := new(big.Int).SetBytes(key)
+		puzzles[i] = &PuzzleRSW{
+			n:        n,
+			a:        tl.a,
+			t:        tl.t,
+			ck:       new(big.Int).Xor(b, k),
+			combiner: CombinerXOR,
+		}
+	}
+	return
+}
+
+// validateBatchPuzzle checks that pz is a usable member of a SolveBatch
+// batch: not just a non-nil pointer, but one with all the fields an
+// actual SetupBatch puzzle would have. A partially constructed or
+// failed-decode *PuzzleRSW is non-nil but has nil n/a/t/ck, which would
+// otherwise panic the first time SolveBatch touches those fields.
+func validateBatchPuzzle(pz *PuzzleRSW, i int) (err error) {
+	if pz == nil {
+		return fmt.Errorf("Puzzle %d is nil", i)
+	}
+	if pz.n == nil || pz.a == nil || pz.t == nil || pz.ck == nil {
+		return fmt.Errorf("Puzzle %d is missing required fields", i)
+	}
+	return
+}
+
+// SolveBatch is SolveBatchContext with a background context and default
+// options - see SolveBatchContext for the cancellation, progress, and
+// checkpointing this doesn't give you.
+func SolveBatch(puzzles []*PuzzleRSW) (answers [][]byte, err error) {
+	return SolveBatchContext(context.Background(), puzzles, SolveOptions{})
+}
+
+// SolveBatchContext verifies that every puzzle in puzzles shares the
+// (n, a, t) triple SetupBatch gives them, performs the t squarings
+// exactly once to recover the shared b, and combines it with each
+// puzzle's ck to recover every key. This turns solving N puzzles from
+// N*T work into T + N*O(1) work - the same trick SetupBatch plays on the
+// setup side.
+//
+// Batch solving is the same "t chosen for hours of wall-clock time"
+// scenario SolveContext exists for, so the one shared squaring pass is
+// built on the same chunkedLoop: it can be cancelled via ctx, watched
+// through opts.Progress, and checkpointed/resumed via the first puzzle's
+// Checkpoint/Resume, exactly like a single-puzzle SolveContext.
+func SolveBatchContext(ctx context.Context, puzzles []*PuzzleRSW, opts SolveOptions) (answers [][]byte, err error) {
+	if len(puzzles) == 0 {
+		return
+	}
+
+	first := puzzles[0]
+	if err = validateBatchPuzzle(first, 0); err != nil {
+		return
+	}
+	for i, pz := range puzzles[1:] {
+		if err = validateBatchPuzzle(pz, i+1); err != nil {
+			return
+		}
+		if pz.n.Cmp(first.n) != 0 || pz.a.Cmp(first.a) != 0 || pz.t.Cmp(first.t) != 0 {
+			err = fmt.Errorf("Puzzle %d does not share (n, a, t) with the rest of the batch", i+1)
+			return
+		}
+	}
+
+	interval := opts.CheckInterval
+	if interval == 0 {
+		interval = defaultCheckInterval
+	}
+
+	t := first.t.Uint64()
+	b := new(big.Int).Set(first.a)
+	remaining := t
+	if first.progress != nil {
+		if first.progress.proving {
+			err = fmt.Errorf("Puzzle 0 has a checkpointed ProveContext in progress, not a plain solve")
+			return
+		}
+		b = new(big.Int).Set(first.progress.x)
+		remaining = first.progress.remaining
+	}
+
+	var left uint64
+	if left, err = chunkedLoop(ctx, remaining, t, interval, opts.Progress, func() {
+		b.Mul(b, b).Mod(b, first.n)
+	}); err != nil {
+		first.progress = &solveProgress{x: b, remaining: left}
+		err = fmt.Errorf("SolveBatchContext was cancelled with %d squarings remaining: %s", left, err)
+		return
+	}
+	first.progress = nil
+
+	answers = make([][]byte, len(puzzles))
+	for i, pz := range puzzles {
+		if answers[i], err = pz.combine(b); err != nil {
+			err = fmt.Errorf("Could not combine puzzle %d: %s", i, err)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,122 @@
+package rsw
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestSetupBatchAndSolveBatch(t *testing.T) {
+	tl := mustNew(t, nil, 2, 256)
+	keys := [][]byte{[]byte("bid one"), []byte("bid two"), []byte("bid three")}
+
+	puzzles, err := tl.SetupBatch(keys, 40)
+	if err != nil {
+		t.Fatalf("SetupBatch: %s", err)
+	}
+
+	pzs := make([]*PuzzleRSW, len(puzzles))
+	for i, p := range puzzles {
+		pzs[i] = p.(*PuzzleRSW)
+	}
+
+	answers, err := SolveBatch(pzs)
+	if err != nil {
+		t.Fatalf("SolveBatch: %s", err)
+	}
+	for i, key := range keys {
+		if new(big.Int).SetBytes(answers[i]).Cmp(new(big.Int).SetBytes(key)) != 0 {
+			t.Fatalf("puzzle %d solved to %x, want %x", i, answers[i], key)
+		}
+	}
+}
+
+// TestSolveBatchNilFieldsDoesNotPanic guards against a non-nil
+// *PuzzleRSW{} with nil n/a/t/ck fields - e.g. from a failed decode -
+// panicking SolveBatch instead of returning an error.
+func TestSolveBatchNilFieldsDoesNotPanic(t *testing.T) {
+	tl := mustNew(t, []byte("batch with a bad puzzle"), 2, 256)
+	puzzles, err := tl.SetupBatch([][]byte{[]byte("fine")}, 10)
+	if err != nil {
+		t.Fatalf("SetupBatch: %s", err)
+	}
+	pzs := []*PuzzleRSW{puzzles[0].(*PuzzleRSW), {}}
+
+	if _, err = SolveBatch(pzs); err == nil {
+		t.Fatal("expected SolveBatch to reject a puzzle with nil fields")
+	}
+}
+
+func TestSolveBatchRejectsNilPuzzle(t *testing.T) {
+	tl := mustNew(t, []byte("batch with a nil puzzle"), 2, 256)
+	puzzles, err := tl.SetupBatch([][]byte{[]byte("fine")}, 10)
+	if err != nil {
+		t.Fatalf("SetupBatch: %s", err)
+	}
+	pzs := []*PuzzleRSW{puzzles[0].(*PuzzleRSW), nil}
+
+	if _, err = SolveBatch(pzs); err == nil {
+		t.Fatal("expected SolveBatch to reject a nil puzzle")
+	}
+}
+
+func TestSolveBatchRejectsMismatchedPuzzle(t *testing.T) {
+	tl := mustNew(t, []byte("batch one"), 2, 256)
+	puzzles, err := tl.SetupBatch([][]byte{[]byte("fine")}, 10)
+	if err != nil {
+		t.Fatalf("SetupBatch: %s", err)
+	}
+
+	other := mustNew(t, []byte("batch two"), 2, 256)
+	otherPuzzles, err := other.SetupBatch([][]byte{[]byte("different n")}, 10)
+	if err != nil {
+		t.Fatalf("SetupBatch: %s", err)
+	}
+
+	pzs := []*PuzzleRSW{puzzles[0].(*PuzzleRSW), otherPuzzles[0].(*PuzzleRSW)}
+	if _, err = SolveBatch(pzs); err == nil {
+		t.Fatal("expected SolveBatch to reject puzzles that don't share (n, a, t)")
+	}
+}
+
+// TestSolveBatchContextCancelAndResume checks that the shared squaring
+// pass in SolveBatchContext can be cancelled and resumed the same way a
+// single-puzzle SolveContext can, via the first puzzle's Checkpoint.
+func TestSolveBatchContextCancelAndResume(t *testing.T) {
+	tl := mustNew(t, nil, 2, 256)
+	keys := [][]byte{[]byte("resume batch one"), []byte("resume batch two")}
+	puzzles, err := tl.SetupBatch(keys, 8000)
+	if err != nil {
+		t.Fatalf("SetupBatch: %s", err)
+	}
+	pzs := make([]*PuzzleRSW, len(puzzles))
+	for i, p := range puzzles {
+		pzs[i] = p.(*PuzzleRSW)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = SolveBatchContext(ctx, pzs, SolveOptions{CheckInterval: 10}); err == nil {
+		t.Fatal("expected a cancellation error")
+	}
+
+	ckpt, err := pzs[0].Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: %s", err)
+	}
+	resumedFirst, err := Resume(ckpt)
+	if err != nil {
+		t.Fatalf("Resume: %s", err)
+	}
+	pzs[0] = resumedFirst
+
+	answers, err := SolveBatchContext(context.Background(), pzs, SolveOptions{CheckInterval: 10})
+	if err != nil {
+		t.Fatalf("SolveBatchContext after resume: %s", err)
+	}
+	for i, key := range keys {
+		if new(big.Int).SetBytes(answers[i]).Cmp(new(big.Int).SetBytes(key)) != 0 {
+			t.Fatalf("puzzle %d solved to %x, want %x", i, answers[i], key)
+		}
+	}
+}
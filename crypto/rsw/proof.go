@@ -0,0 +1,261 @@
+package rsw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/mit-dci/opencx/crypto"
+)
+
+// rswMarshalVersion is the version byte prefixed to every binary encoding
+// in this package, so a future change to the wire format can be detected
+// on decode instead of silently misparsed.
+const rswMarshalVersion byte = 1
+
+func uint32ToBytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func bytesToUint32(b []byte) uint32 {
+	return binary.BigEndian.Uint32(b)
+}
+
+// rswProofBits is the bit length of the prime l used in the Wesolowski
+// proof. Fixing the length keeps l from leaking anything about the size
+// of the puzzle's inputs, and keeps verification (which exponentiates by
+// l) cheap no matter how large t is.
+const rswProofBits = 128
+
+// RSWProof is a Wesolowski-style succinct proof that Solve's answer came
+// from y = a^(2^t) (mod n), checkable with a handful of modular
+// exponentiations instead of repeating the t squarings Solve performs.
+// See Wesolowski, "Efficient Verifiable Delay Functions" (2019).
+type RSWProof struct {
+	pi *big.Int
+}
+
+// ProvablePuzzle is a crypto.Puzzle that can also produce and check a
+// proof that its answer was computed honestly, rather than forcing the
+// verifier to redo the whole computation.
+type ProvablePuzzle interface {
+	crypto.Puzzle
+	Prove() (answer []byte, proof *RSWProof, err error)
+	Verify(answer []byte, proof *RSWProof) (ok bool, err error)
+}
+
+var _ ProvablePuzzle = (*PuzzleRSW)(nil)
+
+// deriveL hashes the puzzle transcript (n, a, t, y) down to a fixed
+// rswProofBits-bit odd number and walks forward to the next prime with
+// Miller-Rabin. Both prover and verifier derive l the same way from
+// public values, so it never needs to be sent across the wire.
+func deriveL(n, a, t, y *big.Int) *big.Int {
+	h := sha256.New()
+	for _, x := range []*big.Int{n, a, t, y} {
+		b := x.Bytes()
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(b)))
+		h.Write(length[:])
+		h.Write(b)
+	}
+	seed := h.Sum(nil)
+
+	l := new(big.Int).SetBytes(seed[:rswProofBits/8])
+	// Fix the bit length and force l odd before walking to the next prime.
+	l.SetBit(l, rswProofBits-1, 1)
+	l.SetBit(l, 0, 1)
+	for !l.ProbablyPrime(20) {
+		l.Add(l, big.NewInt(2))
+	}
+	return l
+}
+
+// combine folds the timelocked value y into the puzzle's answer the way
+// pz.combiner says ck was produced, the same switch Solve makes.
+func (pz *PuzzleRSW) combine(y *big.Int) (answer []byte, err error) {
+	switch pz.combiner {
+	case CombinerADD:
+		return new(big.Int).Sub(pz.ck, y).Bytes(), nil
+	case CombinerXOR:
+		return new(big.Int).Xor(pz.ck, y).Bytes(), nil
+	default:
+		err = fmt.Errorf("Unknown combiner %d", pz.combiner)
+		return
+	}
+}
+
+// decombine is combine's inverse: it recovers y from an already-solved
+// answer so Verify can check it without knowing y up front.
+func (pz *PuzzleRSW) decombine(answer []byte) (y *big.Int, err error) {
+	k := new(big.Int).SetBytes(answer)
+	switch pz.combiner {
+	case CombinerADD:
+		y = new(big.Int).Sub(pz.ck, k)
+		return
+	case CombinerXOR:
+		y = new(big.Int).Xor(pz.ck, k)
+		return
+	default:
+		err = fmt.Errorf("Unknown combiner %d", pz.combiner)
+		return
+	}
+}
+
+// Prove is ProveContext with a background context and default options -
+// see ProveContext for the cancellation, progress, and checkpointing
+// this doesn't give you.
+func (pz *PuzzleRSW) Prove() (answer []byte, proof *RSWProof, err error) {
+	return pz.ProveContext(context.Background(), SolveOptions{})
+}
+
+// ProveContext solves the puzzle, the same way SolveContext does, and
+// additionally returns an RSWProof that lets a verifier check the answer
+// without repeating the t squarings itself.
+//
+// Proving costs roughly 2T squarings rather than SolveContext's T: l is
+// derived via Fiat-Shamir from y = a^(2^t) (mod n), so the second pass
+// that builds q/π can't even start until the first pass has computed y -
+// a true single T-length pass isn't possible. Both passes are built on
+// the same chunkedLoop SolveContext uses, so they get the same
+// cancellation and progress reporting, and either pass can be
+// checkpointed and resumed with Checkpoint/Resume exactly like a plain
+// solve.
+func (pz *PuzzleRSW) ProveContext(ctx context.Context, opts SolveOptions) (answer []byte, proof *RSWProof, err error) {
+	interval := opts.CheckInterval
+	if interval == 0 {
+		interval = defaultCheckInterval
+	}
+	t := pz.t.Uint64()
+
+	var y, l, pi, r *big.Int
+	if pz.progress != nil && pz.progress.proving {
+		y, l, pi, r = pz.progress.y, pz.progress.l, pz.progress.pi, pz.progress.r
+	} else {
+		// First pass: y = a^(2^t) (mod n). This resumes a plain
+		// SolveContext checkpoint if one is pending, since it's the
+		// exact same loop.
+		x := new(big.Int).Set(pz.a)
+		firstRemaining := t
+		if pz.progress != nil {
+			x = new(big.Int).Set(pz.progress.x)
+			firstRemaining = pz.progress.remaining
+		}
+
+		var left uint64
+		if left, err = chunkedLoop(ctx, firstRemaining, t, interval, opts.Progress, func() {
+			x.Mul(x, x).Mod(x, pz.n)
+		}); err != nil {
+			pz.progress = &solveProgress{x: x, remaining: left}
+			err = fmt.Errorf("ProveContext was cancelled computing y with %d squarings remaining: %s", left, err)
+			return
+		}
+
+		y = x
+		l = deriveL(pz.n, pz.a, pz.t, y)
+		pi = big.NewInt(1)
+		r = big.NewInt(1)
+	}
+
+	remaining := t
+	if pz.progress != nil && pz.progress.proving {
+		remaining = pz.progress.remaining
+	}
+
+	// Second pass: walk the same t doublings, but now track the running
+	// exponent modulo l so q = floor(2^t / l) falls out one bit at a
+	// time, exactly like long division produces a quotient bit per step.
+	// π = a^q (mod n) is accumulated alongside it, so we never have to
+	// materialize 2^t or q itself.
+	two := big.NewInt(2)
+	var left uint64
+	if left, err = chunkedLoop(ctx, remaining, t, interval, opts.Progress, func() {
+		r.Mul(r, two)
+		bit := uint(0)
+		if r.Cmp(l) >= 0 {
+			r.Sub(r, l)
+			bit = 1
+		}
+		pi.Mul(pi, pi).Mod(pi, pz.n)
+		if bit == 1 {
+			pi.Mul(pi, pz.a).Mod(pi, pz.n)
+		}
+	}); err != nil {
+		pz.progress = &solveProgress{proving: true, y: y, l: l, pi: pi, r: r, remaining: left}
+		err = fmt.Errorf("ProveContext was cancelled building π with %d squarings remaining: %s", left, err)
+		return
+	}
+
+	pz.progress = nil
+	if answer, err = pz.combine(y); err != nil {
+		err = fmt.Errorf("Could not combine y with ck: %s", err)
+		return
+	}
+	proof = &RSWProof{pi: pi}
+	return
+}
+
+// Verify checks that answer is the correct solution to pz given proof,
+// using three modular exponentiations (2^t mod l, π^l mod n, and a^r mod
+// n) rather than the t squarings Solve would need to redo the work.
+func (pz *PuzzleRSW) Verify(answer []byte, proof *RSWProof) (ok bool, err error) {
+	if proof == nil || proof.pi == nil {
+		err = fmt.Errorf("Proof is missing π")
+		return
+	}
+
+	var y *big.Int
+	if y, err = pz.decombine(answer); err != nil {
+		err = fmt.Errorf("Could not recover y from answer: %s", err)
+		return
+	}
+
+	l := deriveL(pz.n, pz.a, pz.t, y)
+	r := new(big.Int).Exp(big.NewInt(2), pz.t, l)
+
+	lhs := new(big.Int).Exp(proof.pi, l, pz.n)
+	lhs.Mul(lhs, new(big.Int).Exp(pz.a, r, pz.n))
+	lhs.Mod(lhs, pz.n)
+
+	ok = lhs.Cmp(y) == 0
+	return
+}
+
+// MarshalBinary encodes proof as a version byte followed by a
+// length-prefixed big-endian encoding of π.
+func (proof *RSWProof) MarshalBinary() (data []byte, err error) {
+	if proof == nil || proof.pi == nil {
+		err = fmt.Errorf("Cannot marshal a nil proof")
+		return
+	}
+	piBytes := proof.pi.Bytes()
+
+	data = make([]byte, 0, 1+4+len(piBytes))
+	data = append(data, rswMarshalVersion)
+	data = append(data, uint32ToBytes(uint32(len(piBytes)))...)
+	data = append(data, piBytes...)
+	return
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary into proof.
+func (proof *RSWProof) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 1+4 {
+		err = fmt.Errorf("Proof data too short")
+		return
+	}
+	if data[0] != rswMarshalVersion {
+		err = fmt.Errorf("Unsupported proof encoding version %d", data[0])
+		return
+	}
+	piLen := bytesToUint32(data[1:5])
+	if uint32(len(data)-5) != piLen {
+		err = fmt.Errorf("Proof data length mismatch: expected %d bytes for π, got %d", piLen, len(data)-5)
+		return
+	}
+	proof.pi = new(big.Int).SetBytes(data[5:])
+	return
+}
@@ -0,0 +1,129 @@
+package rsw
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestProveVerifyRoundTrip(t *testing.T) {
+	key := []byte("proven and verified")
+	tl := mustNew(t, key, 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(60)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	answer, proof, err := pz.Prove()
+	if err != nil {
+		t.Fatalf("Prove: %s", err)
+	}
+	if new(big.Int).SetBytes(answer).Cmp(new(big.Int).SetBytes(key)) != 0 {
+		t.Fatalf("Prove returned %x, want %x", answer, key)
+	}
+
+	ok, err := pz.Verify(answer, proof)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if !ok {
+		t.Fatal("Verify rejected a proof produced by Prove")
+	}
+}
+
+func TestVerifyRejectsWrongAnswer(t *testing.T) {
+	key := []byte("proven and verified")
+	tl := mustNew(t, key, 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(60)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	_, proof, err := pz.Prove()
+	if err != nil {
+		t.Fatalf("Prove: %s", err)
+	}
+
+	ok, err := pz.Verify([]byte("wrong answer entirely"), proof)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if ok {
+		t.Fatal("Verify accepted a proof against a mismatched answer")
+	}
+}
+
+// TestProveContextCancelAndResume checks that a ProveContext cancelled
+// during its first pass (computing y) can be checkpointed and resumed,
+// and that the resumed call finishes both passes with a proof that
+// verifies - see ProveContext.
+func TestProveContextCancelAndResume(t *testing.T) {
+	key := []byte("resume a proof in progress")
+	tl := mustNew(t, key, 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(8000)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err = pz.ProveContext(ctx, SolveOptions{CheckInterval: 10}); err == nil {
+		t.Fatal("expected a cancellation error")
+	}
+
+	ckpt, err := pz.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: %s", err)
+	}
+	resumed, err := Resume(ckpt)
+	if err != nil {
+		t.Fatalf("Resume: %s", err)
+	}
+
+	answer, proof, err := resumed.ProveContext(context.Background(), SolveOptions{CheckInterval: 10})
+	if err != nil {
+		t.Fatalf("ProveContext after resume: %s", err)
+	}
+	if new(big.Int).SetBytes(answer).Cmp(new(big.Int).SetBytes(key)) != 0 {
+		t.Fatalf("resumed ProveContext returned %x, want %x", answer, key)
+	}
+
+	ok, err := resumed.Verify(answer, proof)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if !ok {
+		t.Fatal("Verify rejected a proof produced by a resumed ProveContext")
+	}
+}
+
+func TestProofMarshalBinaryRoundTrip(t *testing.T) {
+	key := []byte("marshal this proof")
+	tl := mustNew(t, key, 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(40)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	_, proof, err := pz.Prove()
+	if err != nil {
+		t.Fatalf("Prove: %s", err)
+	}
+
+	data, err := proof.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+
+	got := new(RSWProof)
+	if err = got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %s", err)
+	}
+	if got.pi.Cmp(proof.pi) != 0 {
+		t.Fatalf("round-tripped π = %s, want %s", got.pi, proof.pi)
+	}
+}
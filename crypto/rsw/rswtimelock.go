@@ -17,15 +17,46 @@ type TimelockRSW struct {
 	q          *big.Int
 	t          *big.Int
 	a          *big.Int
+
+	// nCache, phiCache, and qInv are memoized after first use so that
+	// setting up many puzzles from the same (p, q) - e.g. batching many
+	// orders' worth of timelock puzzles for the exchange - doesn't redo
+	// this arithmetic, or worse, force the caller to regenerate an RSA
+	// key, for every call to SetupTimelockPuzzle.
+	nCache   *big.Int
+	phiCache *big.Int
+	qInv     *big.Int
 }
 
+// Combiner selects how a PuzzleRSW folds its timelocked value b = a^(2^t)
+// (mod n) together with the key to produce ck, and therefore which of
+// SolveCkXOR/SolveCkADD undoes it again. It's a field on the struct
+// rather than something Solve hardcodes so that a puzzle decoded off the
+// wire (see MarshalBinary/MarshalJSON) solves correctly no matter which
+// variant produced it.
+type Combiner uint8
+
+const (
+	// CombinerXOR is ck = b ⊕ k.
+	CombinerXOR Combiner = iota
+	// CombinerADD is ck = b + k.
+	CombinerADD
+)
+
 // PuzzleRSW is the puzzle that can be then solved by repeated modular squaring
 type PuzzleRSW struct {
 	n *big.Int
 	a *big.Int
 	t *big.Int
-	// We use C_k = b ⊕ k, I have add functionality but I don't know what's "better"
-	ck *big.Int
+	// ck is b combined with the key via combiner - either C_k = b ⊕ k or
+	// C_k = b + k.
+	ck       *big.Int
+	combiner Combiner
+
+	// progress holds the in-progress state of a cancelled SolveContext
+	// call, if any, so a later call resumes the squaring loop instead of
+	// starting over from a. See SolveContext and Checkpoint.
+	progress *solveProgress
 }
 
 // New creates a new TimelockRSW with p and q generated as per crypto/rsa, and an input a as well as number of bits for the RSA key size.
@@ -63,61 +94,133 @@ func New2048A2(key []byte) (tl crypto.Timelock, err error) {
 	return New(key, 2, 2048)
 }
 
+// NewFromPrimes creates a new TimelockRSW from caller-supplied primes p and
+// q, instead of generating them through rsa.GenerateMultiPrimeKey. This is
+// for callers that already have externally generated safe primes - e.g. a
+// shared auctioneer modulus set up once and reused for SetupBatch - and
+// would rather not pay for (or wait on) fresh RSA key generation.
+func NewFromPrimes(p, q *big.Int, key []byte, a int64) (timelock crypto.Timelock, err error) {
+	if p == nil || q == nil {
+		err = fmt.Errorf("P and q must both be set")
+		return
+	}
+	if p.Cmp(q) == 0 {
+		err = fmt.Errorf("P and q must be distinct primes")
+		return
+	}
+	// b()'s CRT shortcut only holds if p-1 and q-1 really are ϕ(p) and
+	// ϕ(q); a composite masquerading as prime here would make the
+	// CRT-accelerated b diverge from the literal a^(2^t) (mod n) an
+	// honest Solve computes, making the puzzle unsolvable by anyone.
+	if !p.ProbablyPrime(20) || !q.ProbablyPrime(20) {
+		err = fmt.Errorf("P and q must both be prime")
+		return
+	}
+	tl := new(TimelockRSW)
+	tl.rsaKeyBits = p.BitLen() + q.BitLen()
+	tl.p = p
+	tl.q = q
+	tl.a = big.NewInt(a)
+	tl.key = key
+
+	timelock = tl
+	return
+}
+
 func (tl *TimelockRSW) n() (n *big.Int, err error) {
+	if tl.nCache != nil {
+		n = tl.nCache
+		return
+	}
 	if tl.p == nil || tl.q == nil {
 		err = fmt.Errorf("Must set up p and q to get n")
 		return
 	}
 	// n = pq
-	n = new(big.Int).Mul(tl.p, tl.q)
+	tl.nCache = new(big.Int).Mul(tl.p, tl.q)
+	n = tl.nCache
 	return
 }
 
 // ϕ() = phi(n) = (p-1)(q-1)
 func (tl *TimelockRSW) ϕ() (ϕ *big.Int, err error) {
+	if tl.phiCache != nil {
+		ϕ = tl.phiCache
+		return
+	}
 	if tl.p == nil || tl.q == nil {
 		err = fmt.Errorf("Must set up p and q to get the ϕ")
 		return
 	}
 	// ϕ(n) = (p-1)(q-1). We assume p and q are prime, and n = pq.
-	ϕ = new(big.Int).Mul(new(big.Int).Sub(tl.p, big.NewInt(int64(1))), new(big.Int).Sub(tl.q, big.NewInt(1)))
+	tl.phiCache = new(big.Int).Mul(new(big.Int).Sub(tl.p, big.NewInt(int64(1))), new(big.Int).Sub(tl.q, big.NewInt(1)))
+	ϕ = tl.phiCache
 	return
 }
 
-// e = 2^t (mod ϕ()) = 2^t (mod phi(n))
-func (tl *TimelockRSW) e() (e *big.Int, err error) {
-	if tl.t == nil {
-		err = fmt.Errorf("Must set up t in order to get e")
+// qInverse returns (the cached) q^-1 (mod p), used to recombine the CRT
+// halves of b() the same way crypto/rsa's PrecomputedValues speeds up
+// private-key operations.
+func (tl *TimelockRSW) qInverse() (qInv *big.Int, err error) {
+	if tl.qInv != nil {
+		qInv = tl.qInv
+		return
+	}
+	if tl.p == nil || tl.q == nil {
+		err = fmt.Errorf("Must set up p and q to get qInv")
 		return
 	}
-	var ϕ *big.Int
-	if ϕ, err = tl.ϕ(); err != nil {
-		err = fmt.Errorf("Could not find ϕ: %s", err)
+	if qInv = new(big.Int).ModInverse(tl.q, tl.p); qInv == nil {
+		err = fmt.Errorf("Q has no inverse mod p, p and q must be distinct primes")
 		return
 	}
-	// e = 2^t mod ϕ()
-	e = new(big.Int).Exp(big.NewInt(int64(2)), tl.t, ϕ)
+	tl.qInv = qInv
 	return
 }
 
-// b = a^(e()) (mod n()) = a^e (mod n) = a^(2^t (mod ϕ())) (mod n) = a^(2^t) (mod n)
+// b = a^(2^t) (mod n), computed via CRT over p and q rather than over the
+// full-size n: t_p = 2^t (mod p-1) and t_q = 2^t (mod q-1) take the place
+// of 2^t (mod ϕ(n)), b_p = a^(t_p) (mod p) and b_q = a^(t_q) (mod q) take the place
+// of the single big exponentiation, and qInv recombines the two halves.
+// This is the same trick crypto/rsa's PrecomputedValues uses to speed up
+// private-key operations once p and q are known.
 func (tl *TimelockRSW) b() (b *big.Int, err error) {
 	if tl.a == nil {
 		err = fmt.Errorf("Must set up a and n in order to get b")
 		return
 	}
+	if tl.t == nil {
+		err = fmt.Errorf("Must set up t in order to get b")
+		return
+	}
 	var n *big.Int
 	if n, err = tl.n(); err != nil {
 		err = fmt.Errorf("Could not find n: %s", err)
 		return
 	}
-	var e *big.Int
-	if e, err = tl.e(); err != nil {
-		err = fmt.Errorf("Could not find e: %s", err)
+	var qInv *big.Int
+	if qInv, err = tl.qInverse(); err != nil {
+		err = fmt.Errorf("Could not find qInv: %s", err)
 		return
 	}
-	// b = a^(e()) (mod n())
-	b = new(big.Int).Exp(tl.a, e, n)
+
+	pMinus1 := new(big.Int).Sub(tl.p, big.NewInt(1))
+	qMinus1 := new(big.Int).Sub(tl.q, big.NewInt(1))
+
+	tP := new(big.Int).Exp(big.NewInt(2), tl.t, pMinus1)
+	tQ := new(big.Int).Exp(big.NewInt(2), tl.t, qMinus1)
+
+	bP := new(big.Int).Exp(tl.a, tP, tl.p)
+	bQ := new(big.Int).Exp(tl.a, tQ, tl.q)
+
+	// CRT recombination: b = bQ + q*((qInv*(bP - bQ)) mod p)
+	h := new(big.Int).Sub(bP, bQ)
+	h.Mul(h, qInv)
+	h.Mod(h, tl.p)
+
+	b = new(big.Int).Mul(h, tl.q)
+	b.Add(b, bQ)
+	b.Mod(b, n)
 	return
 }
 
@@ -166,10 +269,11 @@ func (tl *TimelockRSW) SetupTimelockPuzzle(t uint64) (puzzle crypto.Puzzle, answ
 	}
 
 	rswPuzzle := &PuzzleRSW{
-		n:  n,
-		a:  tl.a,
-		t:  tl.t,
-		ck: ck,
+		n:        n,
+		a:        tl.a,
+		t:        tl.t,
+		ck:       ck,
+		combiner: CombinerXOR,
 	}
 	puzzle = rswPuzzle
 
@@ -195,7 +299,13 @@ func (pz *PuzzleRSW) SolveCkXOR() (answer []byte, err error) {
 	return new(big.Int).Xor(pz.ck, new(big.Int).Exp(pz.a, new(big.Int).Exp(big.NewInt(2), pz.t, nil), pz.n)).Bytes(), nil
 }
 
-// Solve solves the puzzle by repeated squarings
+// Solve solves the puzzle by repeated squarings, combining the result
+// with ck the way pz.combiner says it was produced.
 func (pz *PuzzleRSW) Solve() (answer []byte, err error) {
-	return pz.SolveCkXOR()
+	switch pz.combiner {
+	case CombinerADD:
+		return pz.SolveCkADD()
+	default:
+		return pz.SolveCkXOR()
+	}
 }
\ No newline at end of file
@@ -0,0 +1,78 @@
+package rsw
+
+import (
+	"math/big"
+	"testing"
+)
+
+func mustNew(t *testing.T, key []byte, a int64, bits int) *TimelockRSW {
+	t.Helper()
+	timelock, err := New(key, a, bits)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	return timelock.(*TimelockRSW)
+}
+
+func TestSetupAndSolveRoundTrip(t *testing.T) {
+	key := []byte("a reasonably long secret key")
+	tl := mustNew(t, key, 2, 256)
+
+	puzzle, _, err := tl.SetupTimelockPuzzle(40)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+
+	got, err := puzzle.Solve()
+	if err != nil {
+		t.Fatalf("Solve: %s", err)
+	}
+	if new(big.Int).SetBytes(got).Cmp(new(big.Int).SetBytes(key)) != 0 {
+		t.Fatalf("Solve returned %x, want %x", got, key)
+	}
+}
+
+func TestNewFromPrimesRejectsComposite(t *testing.T) {
+	p := big.NewInt(1000003) // prime
+	q := big.NewInt(1000015) // = 5 * 200003, composite
+
+	if _, err := NewFromPrimes(p, q, []byte("key"), 2); err == nil {
+		t.Fatal("expected NewFromPrimes to reject a composite q")
+	}
+}
+
+func TestNewFromPrimesRejectsEqualPrimes(t *testing.T) {
+	p := big.NewInt(1000003)
+	if _, err := NewFromPrimes(p, p, []byte("key"), 2); err == nil {
+		t.Fatal("expected NewFromPrimes to reject p == q")
+	}
+}
+
+// TestNewFromPrimesCRTMatchesHonestSolve guards against the CRT
+// shortcut in b() silently diverging from the literal a^(2^t) (mod n)
+// an honest Solve computes - which is exactly what happens if either
+// prime isn't actually prime.
+func TestNewFromPrimesCRTMatchesHonestSolve(t *testing.T) {
+	p := big.NewInt(1000003)
+	q := big.NewInt(999983)
+	key := []byte("crt acceleration must match honest solve")
+
+	timelock, err := NewFromPrimes(p, q, key, 2)
+	if err != nil {
+		t.Fatalf("NewFromPrimes: %s", err)
+	}
+	tl := timelock.(*TimelockRSW)
+
+	puzzle, _, err := tl.SetupTimelockPuzzle(30)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+
+	got, err := puzzle.Solve()
+	if err != nil {
+		t.Fatalf("Solve: %s", err)
+	}
+	if new(big.Int).SetBytes(got).Cmp(new(big.Int).SetBytes(key)) != 0 {
+		t.Fatalf("CRT-accelerated puzzle disagreed with honest Solve: got %x want %x", got, key)
+	}
+}
@@ -0,0 +1,211 @@
+package rsw
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// kindRSWXOR and kindRSWADD are the JSON "kind" discriminators for the two
+// PuzzleRSW combiner variants, playing the same role jwk's "kty" plays
+// for key types.
+const (
+	kindRSWXOR = "rsw-xor"
+	kindRSWADD = "rsw-add"
+)
+
+func combinerKind(c Combiner) (kind string, err error) {
+	switch c {
+	case CombinerXOR:
+		return kindRSWXOR, nil
+	case CombinerADD:
+		return kindRSWADD, nil
+	default:
+		err = fmt.Errorf("Unknown combiner %d", c)
+		return
+	}
+}
+
+// validateT rejects a decoded t that doesn't fit a uint64, since
+// SolveContext/ProveContext/SolveBatchContext all eventually call
+// t.Uint64(), which is documented as undefined (in practice: silently
+// truncating) when t doesn't fit.
+func validateT(t *big.Int) (err error) {
+	if !t.IsUint64() {
+		err = fmt.Errorf("T does not fit in a uint64: %s", t)
+	}
+	return
+}
+
+func kindCombiner(kind string) (c Combiner, err error) {
+	switch kind {
+	case kindRSWXOR:
+		return CombinerXOR, nil
+	case kindRSWADD:
+		return CombinerADD, nil
+	default:
+		err = fmt.Errorf("Unknown puzzle kind %q", kind)
+		return
+	}
+}
+
+// putBigInt appends a 4-byte big-endian length prefix and x's big-endian
+// bytes to data.
+func putBigInt(data []byte, x *big.Int) []byte {
+	b := x.Bytes()
+	data = append(data, uint32ToBytes(uint32(len(b)))...)
+	data = append(data, b...)
+	return data
+}
+
+// getBigInt reads a value written by putBigInt off the front of data,
+// returning the remainder.
+func getBigInt(data []byte) (x *big.Int, rest []byte, err error) {
+	if len(data) < 4 {
+		err = fmt.Errorf("Not enough data for a length prefix")
+		return
+	}
+	n := bytesToUint32(data[:4])
+	data = data[4:]
+	if uint32(len(data)) < n {
+		err = fmt.Errorf("Not enough data for a %d-byte integer", n)
+		return
+	}
+	x = new(big.Int).SetBytes(data[:n])
+	rest = data[n:]
+	return
+}
+
+// MarshalBinary encodes pz as a version byte, a combiner discriminator
+// byte, and length-prefixed big-endian encodings of n, a, t, and ck in
+// that order, so a puzzle decoded on the other end of the wire knows
+// whether to solve itself with SolveCkXOR or SolveCkADD.
+func (pz *PuzzleRSW) MarshalBinary() (data []byte, err error) {
+	if _, err = combinerKind(pz.combiner); err != nil {
+		return nil, err
+	}
+	data = append(data, rswMarshalVersion, byte(pz.combiner))
+	data = putBigInt(data, pz.n)
+	data = putBigInt(data, pz.a)
+	data = putBigInt(data, pz.t)
+	data = putBigInt(data, pz.ck)
+	return
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary into pz.
+func (pz *PuzzleRSW) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 2 {
+		err = fmt.Errorf("Puzzle data too short")
+		return
+	}
+	if data[0] != rswMarshalVersion {
+		err = fmt.Errorf("Unsupported puzzle encoding version %d", data[0])
+		return
+	}
+	combiner := Combiner(data[1])
+	if _, err = combinerKind(combiner); err != nil {
+		return
+	}
+	rest := data[2:]
+
+	var n, a, t, ck *big.Int
+	if n, rest, err = getBigInt(rest); err != nil {
+		err = fmt.Errorf("Could not decode n: %s", err)
+		return
+	}
+	if a, rest, err = getBigInt(rest); err != nil {
+		err = fmt.Errorf("Could not decode a: %s", err)
+		return
+	}
+	if t, rest, err = getBigInt(rest); err != nil {
+		err = fmt.Errorf("Could not decode t: %s", err)
+		return
+	}
+	if err = validateT(t); err != nil {
+		return
+	}
+	if ck, _, err = getBigInt(rest); err != nil {
+		err = fmt.Errorf("Could not decode ck: %s", err)
+		return
+	}
+
+	pz.n, pz.a, pz.t, pz.ck, pz.combiner = n, a, t, ck, combiner
+	return
+}
+
+// puzzleRSWJSON is the JWK-inspired wire form of a PuzzleRSW: base64url
+// big integers under short member names, with "kind" standing in for
+// jwk's "kty".
+type puzzleRSWJSON struct {
+	Kind string `json:"kind"`
+	N    string `json:"n"`
+	A    string `json:"a"`
+	T    string `json:"t"`
+	Ck   string `json:"ck"`
+}
+
+func base64URLBigInt(x *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(x.Bytes())
+}
+
+func bigIntFromBase64URL(s string) (x *big.Int, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return
+	}
+	x = new(big.Int).SetBytes(b)
+	return
+}
+
+// MarshalJSON encodes pz the way jwk encodes an RSA modulus: base64url
+// integers under short member names, e.g. {"kind":"rsw-xor","n":"...",...}.
+func (pz *PuzzleRSW) MarshalJSON() (data []byte, err error) {
+	var kind string
+	if kind, err = combinerKind(pz.combiner); err != nil {
+		return
+	}
+	return json.Marshal(puzzleRSWJSON{
+		Kind: kind,
+		N:    base64URLBigInt(pz.n),
+		A:    base64URLBigInt(pz.a),
+		T:    base64URLBigInt(pz.t),
+		Ck:   base64URLBigInt(pz.ck),
+	})
+}
+
+// UnmarshalJSON decodes data produced by MarshalJSON into pz.
+func (pz *PuzzleRSW) UnmarshalJSON(data []byte) (err error) {
+	var wire puzzleRSWJSON
+	if err = json.Unmarshal(data, &wire); err != nil {
+		return
+	}
+	var combiner Combiner
+	if combiner, err = kindCombiner(wire.Kind); err != nil {
+		return
+	}
+
+	var n, a, t, ck *big.Int
+	if n, err = bigIntFromBase64URL(wire.N); err != nil {
+		err = fmt.Errorf("Could not decode n: %s", err)
+		return
+	}
+	if a, err = bigIntFromBase64URL(wire.A); err != nil {
+		err = fmt.Errorf("Could not decode a: %s", err)
+		return
+	}
+	if t, err = bigIntFromBase64URL(wire.T); err != nil {
+		err = fmt.Errorf("Could not decode t: %s", err)
+		return
+	}
+	if err = validateT(t); err != nil {
+		return
+	}
+	if ck, err = bigIntFromBase64URL(wire.Ck); err != nil {
+		err = fmt.Errorf("Could not decode ck: %s", err)
+		return
+	}
+
+	pz.n, pz.a, pz.t, pz.ck, pz.combiner = n, a, t, ck, combiner
+	return
+}
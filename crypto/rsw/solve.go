@@ -0,0 +1,228 @@
+package rsw
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// defaultCheckInterval is how many squarings SolveContext performs
+// between checks of ctx.Err() when the caller doesn't set CheckInterval:
+// often enough to cancel promptly, rarely enough that the check itself
+// isn't the bottleneck.
+const defaultCheckInterval = 4096
+
+// SolveOptions configures SolveContext and ProveContext.
+type SolveOptions struct {
+	// CheckInterval is how many squarings the loop performs between
+	// checks of ctx.Err() and calls to Progress. Zero means
+	// defaultCheckInterval.
+	CheckInterval uint64
+	// Progress, if set, is called after every CheckInterval squarings
+	// with the number of squarings done so far and the total.
+	Progress func(done, total uint64)
+}
+
+// solveProgress is the state of a squaring loop that was cancelled
+// before finishing. A plain SolveContext only ever needs x and
+// remaining; ProveContext's second pass also needs y, l, pi, and r to
+// pick its loop back up - see ProveContext for what those hold.
+type solveProgress struct {
+	x         *big.Int
+	remaining uint64
+
+	proving bool
+	y       *big.Int
+	l       *big.Int
+	pi      *big.Int
+	r       *big.Int
+}
+
+func uint64ToBytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func bytesToUint64(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// chunkedLoop runs step remaining times in batches of interval,
+// checking ctx.Err() and invoking progress between batches. It is the
+// shared backbone behind SolveContext's squaring and ProveContext's two
+// passes, so the cancel/checkpoint/progress logic only needs to be
+// gotten right once.
+//
+// ctx is only consulted between batches, once there is at least one
+// more batch left to run - so a context that is already cancelled, or
+// that fires the instant the final squaring completes, doesn't discard
+// a result that's already fully computed.
+func chunkedLoop(ctx context.Context, remaining, total, interval uint64, progress func(done, total uint64), step func()) (left uint64, err error) {
+	for remaining > 0 {
+		n := interval
+		if n > remaining {
+			n = remaining
+		}
+		for i := uint64(0); i < n; i++ {
+			step()
+		}
+		remaining -= n
+
+		if remaining == 0 {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			left = remaining
+			return
+		}
+		if progress != nil {
+			progress(total-remaining, total)
+		}
+	}
+	if progress != nil {
+		progress(total, total)
+	}
+	return 0, nil
+}
+
+// SolveContext solves pz the same way Solve does, but as an explicit
+// squaring loop instead of one big.Int.Exp call, so it can be cancelled,
+// timed out, watched, and checkpointed. It checks ctx.Err() and invokes
+// opts.Progress every opts.CheckInterval squarings, and leaves its place
+// in the loop on pz so Checkpoint can save it. This matters because t is
+// often chosen for hours of wall-clock squaring on the exchange side,
+// and a process restart shouldn't throw that work away - see Checkpoint
+// and Resume.
+func (pz *PuzzleRSW) SolveContext(ctx context.Context, opts SolveOptions) (answer []byte, err error) {
+	interval := opts.CheckInterval
+	if interval == 0 {
+		interval = defaultCheckInterval
+	}
+
+	t := pz.t.Uint64()
+	x := new(big.Int).Set(pz.a)
+	remaining := t
+	if pz.progress != nil {
+		if pz.progress.proving {
+			err = fmt.Errorf("Puzzle has a checkpointed ProveContext in progress, call ProveContext to resume it")
+			return
+		}
+		x = new(big.Int).Set(pz.progress.x)
+		remaining = pz.progress.remaining
+	}
+
+	var left uint64
+	if left, err = chunkedLoop(ctx, remaining, t, interval, opts.Progress, func() {
+		x.Mul(x, x).Mod(x, pz.n)
+	}); err != nil {
+		pz.progress = &solveProgress{x: x, remaining: left}
+		err = fmt.Errorf("SolveContext was cancelled with %d squarings remaining: %s", left, err)
+		return
+	}
+
+	pz.progress = nil
+	return pz.combine(x)
+}
+
+// Checkpoint serializes pz's in-progress SolveContext or ProveContext
+// state so it can be handed to Resume after a process restart. It only
+// returns data once a solve or prove has been cancelled at least once; a
+// puzzle that hasn't started, or that already finished, has nothing to
+// checkpoint.
+func (pz *PuzzleRSW) Checkpoint() (data []byte, err error) {
+	if pz.progress == nil {
+		err = fmt.Errorf("Puzzle has no in-progress solve to checkpoint")
+		return
+	}
+
+	var puzzleData []byte
+	if puzzleData, err = pz.MarshalBinary(); err != nil {
+		err = fmt.Errorf("Could not marshal puzzle: %s", err)
+		return
+	}
+
+	data = append(data, uint32ToBytes(uint32(len(puzzleData)))...)
+	data = append(data, puzzleData...)
+
+	if pz.progress.proving {
+		data = append(data, 1)
+		data = putBigInt(data, pz.progress.y)
+		data = putBigInt(data, pz.progress.l)
+		data = putBigInt(data, pz.progress.pi)
+		data = putBigInt(data, pz.progress.r)
+	} else {
+		data = append(data, 0)
+		data = putBigInt(data, pz.progress.x)
+	}
+	data = append(data, uint64ToBytes(pz.progress.remaining)...)
+	return
+}
+
+// Resume decodes data produced by Checkpoint back into a *PuzzleRSW that
+// picks up where the checkpointed loop left off instead of starting over:
+// call SolveContext to resume a plain solve, or ProveContext to resume
+// either pass of a proof (SolveContext rejects a checkpoint taken during
+// ProveContext's second pass, since that checkpoint holds y/l/π/r but no
+// x to resume the squaring from).
+func Resume(data []byte) (pz *PuzzleRSW, err error) {
+	if len(data) < 4 {
+		err = fmt.Errorf("Checkpoint data too short")
+		return
+	}
+	puzzleLen := bytesToUint32(data[:4])
+	data = data[4:]
+	if uint32(len(data)) < puzzleLen {
+		err = fmt.Errorf("Checkpoint data too short for its puzzle")
+		return
+	}
+
+	pz = new(PuzzleRSW)
+	if err = pz.UnmarshalBinary(data[:puzzleLen]); err != nil {
+		err = fmt.Errorf("Could not unmarshal puzzle: %s", err)
+		return
+	}
+	data = data[puzzleLen:]
+
+	if len(data) < 1 {
+		err = fmt.Errorf("Checkpoint data too short for its phase marker")
+		return
+	}
+	proving := data[0] == 1
+	data = data[1:]
+
+	progress := &solveProgress{proving: proving}
+	if proving {
+		if progress.y, data, err = getBigInt(data); err != nil {
+			err = fmt.Errorf("Could not decode checkpointed y: %s", err)
+			return
+		}
+		if progress.l, data, err = getBigInt(data); err != nil {
+			err = fmt.Errorf("Could not decode checkpointed l: %s", err)
+			return
+		}
+		if progress.pi, data, err = getBigInt(data); err != nil {
+			err = fmt.Errorf("Could not decode checkpointed π: %s", err)
+			return
+		}
+		if progress.r, data, err = getBigInt(data); err != nil {
+			err = fmt.Errorf("Could not decode checkpointed r: %s", err)
+			return
+		}
+	} else {
+		if progress.x, data, err = getBigInt(data); err != nil {
+			err = fmt.Errorf("Could not decode checkpointed x: %s", err)
+			return
+		}
+	}
+
+	if len(data) < 8 {
+		err = fmt.Errorf("Checkpoint data too short for its remaining count")
+		return
+	}
+	progress.remaining = bytesToUint64(data[:8])
+
+	pz.progress = progress
+	return
+}
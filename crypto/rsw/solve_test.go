@@ -0,0 +1,153 @@
+package rsw
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+// cancelAfterN is a context.Context that reports no error for its first n
+// calls to Err(), then reports context.Canceled forever after - used to
+// force cancellation during a specific pass of a multi-pass loop like
+// ProveContext's, without racing on wall-clock timing.
+type cancelAfterN struct {
+	context.Context
+	calls int32
+	after int32
+}
+
+func (c *cancelAfterN) Err() error {
+	if atomic.AddInt32(&c.calls, 1) > c.after {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestSolveContextMatchesSolve(t *testing.T) {
+	key := []byte("context solve matches plain solve")
+	tl := mustNew(t, key, 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(500)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	answer, err := pz.SolveContext(context.Background(), SolveOptions{CheckInterval: 50})
+	if err != nil {
+		t.Fatalf("SolveContext: %s", err)
+	}
+	if new(big.Int).SetBytes(answer).Cmp(new(big.Int).SetBytes(key)) != 0 {
+		t.Fatalf("SolveContext returned %x, want %x", answer, key)
+	}
+}
+
+// TestSolveContextAlreadyCancelledButDone guards against treating
+// ctx.Err() as a real cancellation once the squaring loop has already
+// produced the final answer - see chunkedLoop.
+func TestSolveContextAlreadyCancelledButDone(t *testing.T) {
+	tl := mustNew(t, []byte("short"), 2, 256)
+	// t is small enough to finish within a single default-sized batch.
+	puzzle, _, err := tl.SetupTimelockPuzzle(1)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	answer, err := pz.SolveContext(ctx, SolveOptions{})
+	if err != nil {
+		t.Fatalf("expected a puzzle that finished within one batch to solve despite a cancelled context, got: %s", err)
+	}
+	if new(big.Int).SetBytes(answer).Cmp(new(big.Int).SetBytes([]byte("short"))) != 0 {
+		t.Fatalf("wrong answer from SolveContext: %x", answer)
+	}
+}
+
+func TestSolveContextCancelThenResume(t *testing.T) {
+	key := []byte("resume this solve")
+	tl := mustNew(t, key, 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(5000)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = pz.SolveContext(ctx, SolveOptions{CheckInterval: 10}); err == nil {
+		t.Fatal("expected a cancellation error")
+	}
+
+	ckpt, err := pz.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: %s", err)
+	}
+	resumed, err := Resume(ckpt)
+	if err != nil {
+		t.Fatalf("Resume: %s", err)
+	}
+
+	answer, err := resumed.SolveContext(context.Background(), SolveOptions{CheckInterval: 10})
+	if err != nil {
+		t.Fatalf("SolveContext after resume: %s", err)
+	}
+	if new(big.Int).SetBytes(answer).Cmp(new(big.Int).SetBytes(key)) != 0 {
+		t.Fatalf("resumed solve returned %x, want %x", answer, key)
+	}
+}
+
+// TestSolveContextRejectsProvingCheckpoint guards against a nil-pointer
+// dereference: a checkpoint taken mid-ProveContext's second pass has
+// y/l/pi/r set but no x, so SolveContext resuming it must fail cleanly
+// instead of dereferencing the nil pz.progress.x.
+func TestSolveContextRejectsProvingCheckpoint(t *testing.T) {
+	tl := mustNew(t, []byte("cancel mid proof, resume via solve"), 2, 256)
+	const testT = 8000
+	const testInterval = 10
+	puzzle, _, err := tl.SetupTimelockPuzzle(testT)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	// testT/testInterval batches make up ProveContext's first pass, each
+	// checking ctx.Err() except the last - so this many free passes let
+	// the first pass run to completion, and cancellation then fires on
+	// the second pass's first check.
+	ctx := &cancelAfterN{Context: context.Background(), after: testT/testInterval - 1}
+	if _, _, err = pz.ProveContext(ctx, SolveOptions{CheckInterval: testInterval}); err == nil {
+		t.Fatal("expected ProveContext to report cancellation")
+	}
+	if !pz.progress.proving {
+		t.Fatal("expected cancellation to land in ProveContext's second (proving) pass")
+	}
+
+	ckpt, err := pz.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint: %s", err)
+	}
+	resumed, err := Resume(ckpt)
+	if err != nil {
+		t.Fatalf("Resume: %s", err)
+	}
+
+	if _, err = resumed.SolveContext(context.Background(), SolveOptions{}); err == nil {
+		t.Fatal("expected SolveContext to reject a checkpoint taken during ProveContext's second pass")
+	}
+}
+
+func TestCheckpointWithoutProgressFails(t *testing.T) {
+	tl := mustNew(t, []byte("no progress yet"), 2, 256)
+	puzzle, _, err := tl.SetupTimelockPuzzle(10)
+	if err != nil {
+		t.Fatalf("SetupTimelockPuzzle: %s", err)
+	}
+	pz := puzzle.(*PuzzleRSW)
+
+	if _, err = pz.Checkpoint(); err == nil {
+		t.Fatal("expected Checkpoint to fail for a puzzle with no in-progress solve")
+	}
+}